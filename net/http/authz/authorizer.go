@@ -3,9 +3,9 @@ package authz
 import (
 	"context"
 	"crypto/x509/pkix"
-	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -13,26 +13,47 @@ import (
 	"chain/crypto/x509/name"
 	"chain/database/raft"
 	"chain/errors"
-	"chain/net/http/authn"
 )
 
 var ErrNotAuthorized = errors.New("not authorized")
+var ErrDeniedByPolicy = errors.New("denied by policy")
 
 var builtinGrants = []*Grant{{GuardType: "any", Policy: "public"}}
 
+// denyServerKey is the raft key under which server-scope deny grants are
+// stored. A server-scope deny applies to every policy, e.g. for blocking
+// a compromised x509 subject or access-token ID everywhere at once.
+const denyServerKey = "server"
+
 type Authorizer struct {
-	raftDB        *raft.Service
-	raftPrefix    string
-	policyByRoute map[string][]string
-	extraGrants   map[string][]*Grant // by policy
+	raftDB          *raft.Service
+	raftPrefix      string
+	policyByRoute   map[string][]string
+	extraGrants     map[string][]*Grant // by policy
+	guardsMu        sync.RWMutex
+	guards          map[string]GuardEvaluator
+	auditSink       AuditSink
+	readConsistency ReadConsistency
+	cache           *grantListCache
 }
 
 func NewAuthorizer(rdb *raft.Service, prefix string, policyMap map[string][]string) *Authorizer {
+	return NewAuthorizerWithOptions(rdb, prefix, policyMap, AuthorizerOptions{})
+}
+
+// NewAuthorizerWithOptions is like NewAuthorizer but lets callers trade
+// off read consistency and grant-lookup latency; see AuthorizerOptions.
+func NewAuthorizerWithOptions(rdb *raft.Service, prefix string, policyMap map[string][]string, opts AuthorizerOptions) *Authorizer {
 	a := &Authorizer{
-		raftDB:        rdb,
-		raftPrefix:    prefix,
-		policyByRoute: policyMap,
-		extraGrants:   make(map[string][]*Grant),
+		raftDB:          rdb,
+		raftPrefix:      prefix,
+		policyByRoute:   policyMap,
+		extraGrants:     make(map[string][]*Grant),
+		guards:          builtinGuards(),
+		readConsistency: opts.ReadConsistency,
+	}
+	if opts.CacheTTL > 0 {
+		a.cache = newGrantListCache(opts.CacheTTL)
 	}
 	for _, g := range builtinGrants {
 		a.extraGrants[g.Policy] = append(a.extraGrants[g.Policy], g)
@@ -57,55 +78,197 @@ func (a *Authorizer) GrantInternal(subj pkix.Name) {
 }
 
 func (a *Authorizer) Authorize(req *http.Request) error {
-	policies := a.policyByRoute[strings.TrimRight(req.RequestURI, "/")]
-	if policies == nil || len(policies) == 0 {
-		return errors.New("missing policy on this route")
+	_, err := a.authorize(req, false)
+	return err
+}
+
+// AuthorizeWithExplain behaves like Authorize but also returns a Decision
+// describing which grant matched and, for a denied request, how every
+// guard that was evaluated fared. This is meant for operators debugging
+// why a request (e.g. from a particular certificate) was rejected against
+// a large grant list, not for the hot authorization path.
+func (a *Authorizer) AuthorizeWithExplain(req *http.Request) (*Decision, error) {
+	return a.authorize(req, true)
+}
+
+func (a *Authorizer) authorize(req *http.Request, explain bool) (*Decision, error) {
+	start := time.Now()
+	ctx := req.Context()
+	route := strings.TrimRight(req.RequestURI, "/")
+	policies := a.policyByRoute[route]
+
+	decision := &Decision{}
+	var err error
+	outcome := DecisionDeny
+	defer func() {
+		a.audit(route, policies, decision, outcome, time.Since(start), ctx)
+	}()
+
+	if len(policies) == 0 {
+		err = errors.New("missing policy on this route")
+		return decision, err
 	}
 
-	grants, err := a.grantsByPolicies(policies)
-	if err != nil {
-		return errors.Wrap(err)
+	allows, denies, gerr := a.grantsByPolicies(policies)
+	if gerr != nil {
+		err = errors.Wrap(gerr)
+		return decision, err
 	}
 
-	if !authorized(req.Context(), grants) {
-		return ErrNotAuthorized
+	decision, err = a.decide(ctx, allows, denies, explain)
+	switch {
+	case err == nil:
+		outcome = DecisionAllow
+	case decision.DeniedBy != nil:
+		outcome = DecisionDeniedByRule
 	}
+	return decision, err
+}
 
-	return nil
+// decide evaluates an already-gathered set of allow and deny grants
+// against ctx: deny-before-allow, first match wins within each list. It's
+// split out of authorize so the precedence logic can be exercised without
+// a raft round trip, e.g. from tests that hand-build allows/denies.
+func (a *Authorizer) decide(ctx context.Context, allows, denies []*Grant, explain bool) (*Decision, error) {
+	decision := &Decision{}
+
+	var explanation *[]GuardResult
+	if explain {
+		explanation = &decision.Explanation
+	}
+
+	denyGrant, derr := a.evaluateGrants(ctx, denies, explanation)
+	if derr != nil {
+		return decision, errors.Wrap(derr)
+	}
+	if denyGrant != nil {
+		decision.DeniedBy = denyGrant
+		return decision, errors.Wrap(ErrDeniedByPolicy)
+	}
+
+	allowGrant, aerr := a.evaluateGrants(ctx, allows, explanation)
+	if aerr != nil {
+		return decision, errors.Wrap(aerr)
+	}
+	if allowGrant == nil {
+		return decision, ErrNotAuthorized
+	}
+
+	decision.Allowed = true
+	decision.Matched = allowGrant
+	return decision, nil
+}
+
+func (a *Authorizer) audit(route string, policies []string, decision *Decision, outcome string, latency time.Duration, ctx context.Context) {
+	if a.auditSink == nil {
+		return
+	}
+
+	rec := AuditRecord{
+		Time:     time.Now().UTC(),
+		Route:    route,
+		Policies: policies,
+		Decision: outcome,
+		Subject:  subjectFromContext(ctx),
+		Latency:  latency,
+	}
+	switch {
+	case decision.Matched != nil:
+		rec.GuardType = decision.Matched.GuardType
+	case decision.DeniedBy != nil:
+		rec.GuardType = decision.DeniedBy.GuardType
+	}
+
+	a.auditSink.Audit(rec)
 }
 
-func authorized(ctx context.Context, grants []*Grant) bool {
+// evaluateGrants returns the first grant in grants whose guard matches
+// ctx, or nil if none match. Grants are evaluated in order, so callers
+// that care about precedence (e.g. deny-before-allow) must pass the right
+// slice. Most guard errors (bad config, an unreachable IDP, a malformed
+// CIDR entry) just mean that one guard couldn't determine a match, so
+// evaluation continues with the next grant; only an error wrapped with
+// abortEvaluation (e.g. the access_token_quota guard's ErrRateLimited)
+// stops evaluation and surfaces immediately. When explain is non-nil,
+// every guard evaluated along the way (not just the match) is appended
+// to it.
+func (a *Authorizer) evaluateGrants(ctx context.Context, grants []*Grant, explain *[]GuardResult) (*Grant, error) {
+	if explain != nil {
+		ctx = withTraceOnly(ctx)
+	}
 	for _, g := range grants {
-		switch g.GuardType {
-		case "access_token":
-			if accessTokenGuardData(g) == authn.Token(ctx) {
-				return true
-			}
-		case "x509":
-			pattern, err := name.Parse(string(g.GuardData))
-			if err != nil {
-				break
-			}
-			for _, cert := range authn.X509Certs(ctx) {
-				if matchesX509(pattern, cert.Subject) {
-					return true
-				}
+		ok, err := a.matchesGuard(ctx, g)
+		if aborted, ferr := unwrapAbort(err); aborted {
+			if explain != nil {
+				*explain = append(*explain, GuardResult{Grant: g, Matched: ok, Err: ferr})
 			}
-		case "localhost":
-			if authn.Localhost(ctx) {
-				return true
-			}
-		case "any":
-			return true
+			return nil, ferr
+		}
+		if explain != nil {
+			*explain = append(*explain, GuardResult{Grant: g, Matched: ok, Err: err})
+		}
+		if ok {
+			return g, nil
 		}
 	}
-	return false
+	return nil, nil
 }
 
-func accessTokenGuardData(grant *Grant) string {
-	var v struct{ ID string }
-	json.Unmarshal(grant.GuardData, &v) // ignore error, returns "" on failure
-	return v.ID
+func (a *Authorizer) matchesGuard(ctx context.Context, g *Grant) (bool, error) {
+	a.guardsMu.RLock()
+	ev := a.guards[g.GuardType]
+	a.guardsMu.RUnlock()
+	if ev == nil {
+		return false, nil
+	}
+	return ev.Matches(ctx, g.GuardData)
+}
+
+// abortError marks a guard error that must stop evaluation of the rest of
+// the grant list and be surfaced directly from Authorize, as opposed to a
+// guard that merely failed to determine a match. See abortEvaluation.
+type abortError struct{ err error }
+
+func (e *abortError) Error() string { return e.err.Error() }
+func (e *abortError) Unwrap() error { return e.err }
+
+// abortEvaluation wraps err so evaluateGrants stops evaluating the rest of
+// the grant list and returns err from Authorize, instead of treating the
+// failing guard as a non-match and moving on to the next grant. Use this
+// only for a guard outcome that is itself a definitive verdict on the
+// request, e.g. ErrRateLimited: unlike a guard that couldn't tell whether
+// it matched, a rate limit must not be skipped past.
+func abortEvaluation(err error) error {
+	return &abortError{err: err}
+}
+
+// unwrapAbort reports whether err was produced by abortEvaluation and, if
+// so, returns the error it wraps.
+func unwrapAbort(err error) (bool, error) {
+	ae, ok := err.(*abortError)
+	if !ok {
+		return false, nil
+	}
+	return true, ae.err
+}
+
+// traceOnlyKey marks a context as belonging to an AuthorizeWithExplain
+// call rather than a normal Authorize call.
+type traceOnlyKey struct{}
+
+// withTraceOnly marks ctx so a guard with a side effect on shared state
+// (e.g. the access_token_quota guard draining a token bucket) can skip
+// that side effect while still reporting what its verdict would have
+// been. Without this, calling AuthorizeWithExplain to debug a denial
+// would itself consume a rate-limited credential's quota.
+func withTraceOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceOnlyKey{}, true)
+}
+
+// isTraceOnly reports whether ctx was marked by withTraceOnly.
+func isTraceOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(traceOnlyKey{}).(bool)
+	return v
 }
 
 func matchesX509(pat, x pkix.Name) bool {
@@ -151,19 +314,188 @@ func equalX509Name(a, b pkix.Name) bool {
 	return true
 }
 
-func (a *Authorizer) grantsByPolicies(policies []string) ([]*Grant, error) {
-	var grants []*Grant
+// grantsByPolicies returns the allow and deny grants that apply to
+// policies, including server-scope denies that apply regardless of
+// policy.
+func (a *Authorizer) grantsByPolicies(policies []string) (allows, denies []*Grant, err error) {
 	for _, p := range policies {
-		grants = append(grants, a.extraGrants[p]...)
-		data := a.raftDB.Stale().Get(a.raftPrefix + p)
-		if data != nil {
-			grantList := new(GrantList)
-			err := proto.Unmarshal(data, grantList)
-			if err != nil {
-				return nil, errors.Wrap(err)
-			}
-			grants = append(grants, grantList.GetGrants()...)
+		for _, g := range a.extraGrants[p] {
+			appendGrant(&allows, &denies, g)
+		}
+		grantList, err := a.loadGrantList(a.raftPrefix + p)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, g := range grantList.GetGrants() {
+			appendGrant(&allows, &denies, g)
+		}
+		denyList, err := a.loadGrantList(a.raftPrefix + "deny/" + p)
+		if err != nil {
+			return nil, nil, err
+		}
+		denies = append(denies, denyList.GetGrants()...)
+	}
+
+	serverDenyList, err := a.loadGrantList(a.raftPrefix + "deny/" + denyServerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	denies = append(denies, serverDenyList.GetGrants()...)
+
+	return allows, denies, nil
+}
+
+// appendGrant sorts g into allows or denies by its effect.
+func appendGrant(allows, denies *[]*Grant, g *Grant) {
+	if g.effect() == EffectDeny {
+		*denies = append(*denies, g)
+	} else {
+		*allows = append(*allows, g)
+	}
+}
+
+func (a *Authorizer) loadGrantList(key string) (*GrantList, error) {
+	if a.readConsistency == ReadLinearizable {
+		return fetchGrantList(key, a.raftDB.Get)
+	}
+
+	if a.cache != nil {
+		if gl, ok := a.cache.get(key); ok {
+			return gl, nil
+		}
+	}
+
+	gl, err := fetchGrantList(key, a.raftDB.Stale().Get)
+	if err != nil {
+		return nil, err
+	}
+	if a.cache != nil {
+		a.cache.set(key, gl)
+	}
+	return gl, nil
+}
+
+func fetchGrantList(key string, get func(string) []byte) (*GrantList, error) {
+	grantList := new(GrantList)
+	data := get(key)
+	if data == nil {
+		return grantList, nil
+	}
+	if err := proto.Unmarshal(data, grantList); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return grantList, nil
+}
+
+// InvalidatePolicy evicts any cached GrantLists for policy (its allow
+// list and its deny list), so a grant mutation made outside this
+// Authorizer (e.g. on another node) is visible on the next Authorize
+// call. It is a no-op unless AuthorizerOptions.CacheTTL was set.
+func (a *Authorizer) InvalidatePolicy(policy string) {
+	if a.cache == nil {
+		return
+	}
+	a.cache.invalidate(a.raftPrefix + policy)
+	a.cache.invalidate(a.denyKey(policy))
+}
+
+// InvalidateAll evicts every cached GrantList. It is a no-op unless
+// AuthorizerOptions.CacheTTL was set.
+func (a *Authorizer) InvalidateAll() {
+	if a.cache == nil {
+		return
+	}
+	a.cache.invalidateAll()
+}
+
+// AddDeny adds a deny grant under policy, rejecting any request matching
+// its guard even if an allow grant would otherwise accept it. An empty
+// policy denies the guard across every policy served by this server.
+func (a *Authorizer) AddDeny(policy string, g *Grant) error {
+	g.Effect = EffectDeny
+	if g.CreatedAt == "" {
+		g.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	return a.storeGrant(a.denyKey(policy), g)
+}
+
+// RemoveDeny removes the deny grants under policy for which match returns
+// true.
+func (a *Authorizer) RemoveDeny(policy string, match func(*Grant) bool) error {
+	return a.removeGrants(a.denyKey(policy), match)
+}
+
+// ListGrants returns the allow and deny grants stored in raft under
+// policy. It does not include the built-in or process-local grants added
+// via GrantInternal.
+func (a *Authorizer) ListGrants(policy string) (allows, denies []*Grant, err error) {
+	allowList, err := a.loadGrantList(a.raftPrefix + policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	denyList, err := a.loadGrantList(a.denyKey(policy))
+	if err != nil {
+		return nil, nil, err
+	}
+	return allowList.GetGrants(), denyList.GetGrants(), nil
+}
+
+func (a *Authorizer) denyKey(policy string) string {
+	if policy == "" {
+		policy = denyServerKey
+	}
+	return a.raftPrefix + "deny/" + policy
+}
+
+// storeGrant appends g to the GrantList stored under key. It builds the
+// new list in a fresh slice rather than mutating the one loadGrantList
+// returns: under ReadStale with a cache configured, that's the very
+// *GrantList sitting in grantListCache, shared with concurrent Authorize
+// calls, so writing through it before raftDB.Insert has even been
+// attempted would both race other readers and leave the cache showing a
+// write that never actually committed.
+func (a *Authorizer) storeGrant(key string, g *Grant) error {
+	list, err := a.loadGrantList(key)
+	if err != nil {
+		return err
+	}
+	grants := append(append([]*Grant{}, list.Grants...), g)
+	data, err := proto.Marshal(&GrantList{Grants: grants})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if err := a.raftDB.Insert(key, data); err != nil {
+		return err
+	}
+	if a.cache != nil {
+		a.cache.invalidate(key)
+	}
+	return nil
+}
+
+// removeGrants is storeGrant's counterpart for deletion; see storeGrant
+// for why it builds kept as a new slice instead of filtering list.Grants
+// in place.
+func (a *Authorizer) removeGrants(key string, match func(*Grant) bool) error {
+	list, err := a.loadGrantList(key)
+	if err != nil {
+		return err
+	}
+	kept := make([]*Grant, 0, len(list.Grants))
+	for _, g := range list.Grants {
+		if !match(g) {
+			kept = append(kept, g)
 		}
 	}
-	return grants, nil
+	data, err := proto.Marshal(&GrantList{Grants: kept})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if err := a.raftDB.Insert(key, data); err != nil {
+		return err
+	}
+	if a.cache != nil {
+		a.cache.invalidate(key)
+	}
+	return nil
 }
@@ -0,0 +1,66 @@
+package authz
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecideDenyBeforeAllow(t *testing.T) {
+	a := &Authorizer{guards: builtinGuards()}
+	allow := &Grant{GuardType: "any", Policy: "p"}
+	deny := &Grant{GuardType: "any", Policy: "p", Effect: EffectDeny}
+
+	decision, err := a.decide(context.Background(), []*Grant{allow}, []*Grant{deny}, false)
+	if err == nil {
+		t.Fatal("expected deny to win over an otherwise-matching allow")
+	}
+	if decision.DeniedBy != deny {
+		t.Fatalf("decision.DeniedBy = %v, want %v", decision.DeniedBy, deny)
+	}
+	if decision.Allowed {
+		t.Fatal("decision.Allowed = true for a denied request")
+	}
+}
+
+func TestDecideServerScopeDenyAppliesAcrossPolicies(t *testing.T) {
+	a := &Authorizer{guards: builtinGuards()}
+	allow := &Grant{GuardType: "any", Policy: "some-policy"}
+	// grantsByPolicies appends the server-scope deny list (raftPrefix +
+	// "deny/" + denyServerKey) regardless of which policy is being
+	// checked; decide itself doesn't know or care where a deny came from,
+	// so merging one in directly here exercises the same precedence.
+	serverDeny := &Grant{GuardType: "any", Policy: denyServerKey, Effect: EffectDeny}
+
+	decision, err := a.decide(context.Background(), []*Grant{allow}, []*Grant{serverDeny}, false)
+	if err == nil || decision.DeniedBy != serverDeny {
+		t.Fatalf("server-scope deny did not block the request: decision=%+v err=%v", decision, err)
+	}
+}
+
+func TestDecideAllowsWhenNoDenyMatches(t *testing.T) {
+	a := &Authorizer{guards: builtinGuards()}
+	allow := &Grant{GuardType: "any", Policy: "p"}
+	noMatchDeny := &Grant{GuardType: "unregistered", Policy: "p", Effect: EffectDeny}
+
+	decision, err := a.decide(context.Background(), []*Grant{allow}, []*Grant{noMatchDeny}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decision.Allowed || decision.Matched != allow {
+		t.Fatalf("decision = %+v, want Allowed with Matched = %v", decision, allow)
+	}
+}
+
+func TestPublicGrantAllowsAnyRequest(t *testing.T) {
+	a := NewAuthorizerWithOptions(nil, "", nil, AuthorizerOptions{})
+
+	publicGrants := a.extraGrants["public"]
+	if len(publicGrants) != 1 || publicGrants[0].GuardType != "any" {
+		t.Fatalf("NewAuthorizer did not install the built-in public grant: %+v", publicGrants)
+	}
+
+	decision, err := a.decide(context.Background(), publicGrants, nil, false)
+	if err != nil || !decision.Allowed {
+		t.Fatalf("public grant did not allow an unauthenticated request: decision=%+v err=%v", decision, err)
+	}
+}
@@ -0,0 +1,94 @@
+package authz
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultGrantListCacheSize bounds how many keys' GrantLists a stale-mode
+// Authorizer keeps cached at once.
+const defaultGrantListCacheSize = 1024
+
+type grantListCacheEntry struct {
+	key     string
+	list    *GrantList
+	expires time.Time
+}
+
+// grantListCache is an LRU cache of unmarshaled GrantLists keyed by raft
+// key, with a TTL on top so a ReadStale Authorizer bounds both memory use
+// and how long a revoked grant stays visible.
+type grantListCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu    sync.Mutex
+	ll    *list.List // front = most recently used
+	index map[string]*list.Element
+}
+
+func newGrantListCache(ttl time.Duration) *grantListCache {
+	return &grantListCache{
+		ttl:     ttl,
+		maxSize: defaultGrantListCacheSize,
+		ll:      list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+func (c *grantListCache) get(key string) (*GrantList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*grantListCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.index, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.list, true
+}
+
+func (c *grantListCache) set(key string, gl *GrantList) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.index[key]; ok {
+		entry := el.Value.(*grantListCacheEntry)
+		entry.list = gl
+		entry.expires = time.Now().Add(c.ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&grantListCacheEntry{key: key, list: gl, expires: time.Now().Add(c.ttl)})
+	c.index[key] = el
+
+	for c.ll.Len() > c.maxSize {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.index, oldest.Value.(*grantListCacheEntry).key)
+	}
+}
+
+func (c *grantListCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.ll.Remove(el)
+		delete(c.index, key)
+	}
+}
+
+func (c *grantListCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.index = make(map[string]*list.Element)
+}
@@ -0,0 +1,43 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"chain/net/http/authn"
+)
+
+// matchesCIDR matches the request's remote IP against one or more CIDR
+// ranges. GuardData:
+//
+//	{"cidrs": ["10.0.0.0/8", "::1/128"]}
+//
+// Bad JSON makes the guard a non-match rather than a server error, and an
+// unparseable CIDR entry is skipped while the remaining entries are still
+// checked: one typo'd entry must not block evaluation of the grants that
+// follow it.
+func matchesCIDR(ctx context.Context, guardData []byte) (bool, error) {
+	var v struct {
+		CIDRs []string `json:"cidrs"`
+	}
+	if err := json.Unmarshal(guardData, &v); err != nil {
+		return false, nil
+	}
+
+	ip := authn.RemoteIP(ctx)
+	if ip == nil {
+		return false, nil
+	}
+
+	for _, c := range v.CIDRs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		if n.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
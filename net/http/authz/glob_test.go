@@ -0,0 +1,28 @@
+package authz
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "anything", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+		{"svc-*", "svc-frontend", true},
+		{"svc-*", "other", false},
+		{"*-prod", "api-prod", true},
+		{"*-prod", "api-staging", false},
+		{"svc-*-prod", "svc-api-prod", true},
+		{"svc-*-prod", "svc-api-staging", false},
+		{"*", "", true},
+		{"*", "anything", true},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.s); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package authz
+
+import "fmt"
+
+// Effect values for Grant.Effect. A Grant with no Effect set is treated
+// as EffectAllow for backward compatibility with grants written before
+// deny support existed.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Grant authorizes (or, when Effect is EffectDeny, blocks) access to
+// Policy for any subject whose request context matches GuardType and
+// GuardData. The wire format mirrors the GrantList proto stored in raft.
+type Grant struct {
+	GuardType string `protobuf:"bytes,1,opt,name=guard_type,json=guardType" json:"guard_type,omitempty"`
+	GuardData []byte `protobuf:"bytes,2,opt,name=guard_data,json=guardData" json:"guard_data,omitempty"`
+	Policy    string `protobuf:"bytes,3,opt,name=policy" json:"policy,omitempty"`
+	CreatedAt string `protobuf:"bytes,4,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+	Effect    string `protobuf:"bytes,5,opt,name=effect" json:"effect,omitempty"`
+}
+
+func (g *Grant) Reset()         { *g = Grant{} }
+func (g *Grant) String() string { return fmt.Sprintf("%+v", *g) }
+func (*Grant) ProtoMessage()    {}
+
+// effect returns g.Effect, defaulting to EffectAllow for grants written
+// before Effect existed.
+func (g *Grant) effect() string {
+	if g.Effect == "" {
+		return EffectAllow
+	}
+	return g.Effect
+}
+
+// GrantList is the raft-persisted collection of grants for a single key
+// (a policy name, or a deny-list key under raftPrefix+"deny/").
+type GrantList struct {
+	Grants []*Grant `protobuf:"bytes,1,rep,name=grants" json:"grants,omitempty"`
+}
+
+func (l *GrantList) Reset()         { *l = GrantList{} }
+func (l *GrantList) String() string { return fmt.Sprintf("%+v", *l) }
+func (*GrantList) ProtoMessage()    {}
+
+func (l *GrantList) GetGrants() []*Grant {
+	if l != nil {
+		return l.Grants
+	}
+	return nil
+}
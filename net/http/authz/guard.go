@@ -0,0 +1,74 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+
+	"chain/net/http/authn"
+)
+
+// GuardEvaluator matches a request context against guard-specific data
+// carried in a Grant's GuardData. Registering a GuardEvaluator under a
+// GuardType string via Authorizer.RegisterGuard lets callers add new
+// authorization mechanisms (e.g. SSO/OIDC) without forking this package.
+type GuardEvaluator interface {
+	Matches(ctx context.Context, guardData []byte) (bool, error)
+}
+
+// GuardEvaluatorFunc adapts a function to a GuardEvaluator.
+type GuardEvaluatorFunc func(ctx context.Context, guardData []byte) (bool, error)
+
+func (f GuardEvaluatorFunc) Matches(ctx context.Context, guardData []byte) (bool, error) {
+	return f(ctx, guardData)
+}
+
+// RegisterGuard makes ev available to grants whose GuardType is guardType.
+// Registering an already-registered guardType replaces the previous
+// evaluator, so callers can override a built-in guard if they need to.
+// Safe to call while Authorize is serving concurrent requests.
+func (a *Authorizer) RegisterGuard(guardType string, ev GuardEvaluator) {
+	a.guardsMu.Lock()
+	defer a.guardsMu.Unlock()
+	a.guards[guardType] = ev
+}
+
+// builtinGuards returns the GuardEvaluators every Authorizer starts with.
+func builtinGuards() map[string]GuardEvaluator {
+	return map[string]GuardEvaluator{
+		"access_token":       GuardEvaluatorFunc(matchesAccessToken),
+		"access_token_quota": GuardEvaluatorFunc(matchesAccessTokenQuota),
+		"x509":               GuardEvaluatorFunc(matchesX509Guard),
+		"localhost":          GuardEvaluatorFunc(matchesLocalhost),
+		"any":                GuardEvaluatorFunc(matchesAny),
+		"jwt":                GuardEvaluatorFunc(matchesJWT),
+		"oidc":               GuardEvaluatorFunc(matchesOIDC),
+		"cidr":               GuardEvaluatorFunc(matchesCIDR),
+	}
+}
+
+func matchesAccessToken(ctx context.Context, guardData []byte) (bool, error) {
+	var v struct{ ID string }
+	json.Unmarshal(guardData, &v) // ignore error, returns "" on failure
+	return v.ID == authn.Token(ctx), nil
+}
+
+func matchesX509Guard(ctx context.Context, guardData []byte) (bool, error) {
+	pattern, err := parseX509GuardData(guardData)
+	if err != nil {
+		return false, nil
+	}
+	for _, cert := range authn.X509Certs(ctx) {
+		if pattern.matches(cert) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchesLocalhost(ctx context.Context, _ []byte) (bool, error) {
+	return authn.Localhost(ctx), nil
+}
+
+func matchesAny(context.Context, []byte) (bool, error) {
+	return true, nil
+}
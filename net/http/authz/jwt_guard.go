@@ -0,0 +1,225 @@
+package authz
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"chain/errors"
+	"chain/net/http/authn"
+)
+
+// jwksCacheTTL bounds how long a fetched JWKS is reused before the jwt and
+// oidc guards re-fetch it, so a rotated signing key is picked up without a
+// process restart.
+const jwksCacheTTL = 5 * time.Minute
+
+// httpGuardClient bounds how long a jwt/oidc guard will wait on a slow or
+// unresponsive IdP. Guard evaluation runs synchronously inside Authorize,
+// so an unbounded http.Get would hang the calling request indefinitely.
+var httpGuardClient = &http.Client{Timeout: 5 * time.Second}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksCacheEntry struct {
+	keys    []jwk
+	fetched time.Time
+}
+
+var (
+	jwksCacheMu sync.Mutex
+	jwksCache   = make(map[string]jwksCacheEntry)
+)
+
+func fetchJWKS(jwksURL string) ([]jwk, error) {
+	jwksCacheMu.Lock()
+	entry, ok := jwksCache[jwksURL]
+	jwksCacheMu.Unlock()
+	if ok && time.Since(entry.fetched) < jwksCacheTTL {
+		return entry.keys, nil
+	}
+
+	resp, err := httpGuardClient.Get(jwksURL)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	jwksCacheMu.Lock()
+	jwksCache[jwksURL] = jwksCacheEntry{keys: body.Keys, fetched: time.Now()}
+	jwksCacheMu.Unlock()
+
+	return body.Keys, nil
+}
+
+// matchesJWT verifies an RS256 or ES256 bearer token against the JWKS
+// published at GuardData's jwks_url, then checks the decoded claims
+// against the configured glob patterns. GuardData:
+//
+//	{"jwks_url": "https://idp.example.com/.well-known/jwks.json",
+//	 "claims": {"iss": "https://idp.example.com/", "sub": "svc-*"}}
+func matchesJWT(ctx context.Context, guardData []byte) (bool, error) {
+	var v struct {
+		JWKSURL string            `json:"jwks_url"`
+		Claims  map[string]string `json:"claims"`
+	}
+	if err := json.Unmarshal(guardData, &v); err != nil {
+		return false, nil
+	}
+
+	token := authn.Token(ctx)
+	if token == "" {
+		return false, nil
+	}
+
+	claims, err := verifyJWT(token, v.JWKSURL)
+	if err != nil {
+		return false, nil // an unverifiable token doesn't match; it isn't a server error
+	}
+	return matchesClaims(claims, v.Claims), nil
+}
+
+// verifyJWT checks token's signature against jwksURL and returns its
+// decoded claims if the signature is valid and the token isn't expired.
+func verifyJWT(token, jwksURL string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	keys, err := fetchJWKS(jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig, keys); err != nil {
+		return nil, err
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if exp, ok := claims["exp"].(float64); ok && float64(time.Now().Unix()) > exp {
+		return nil, errors.New("jwt expired")
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg, kid, signed string, sig []byte, keys []jwk) error {
+	h := sha256.Sum256([]byte(signed))
+	for _, k := range keys {
+		if k.Kid != "" && kid != "" && k.Kid != kid {
+			continue
+		}
+		switch alg {
+		case "RS256":
+			pub, err := rsaPublicKey(k)
+			if err != nil {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], sig) == nil {
+				return nil
+			}
+		case "ES256":
+			pub, err := ecdsaPublicKey(k)
+			if err != nil || len(sig) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(pub, h[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return errors.New("jwt signature verification failed")
+}
+
+func rsaPublicKey(k jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	e := 0
+	for _, b := range eBytes {
+		e = e<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: e}, nil
+}
+
+func ecdsaPublicKey(k jwk) (*ecdsa.PublicKey, error) {
+	xBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
+
+// matchesClaims reports whether every pattern in want matches the
+// corresponding string claim in claims.
+func matchesClaims(claims map[string]interface{}, want map[string]string) bool {
+	for name, pattern := range want {
+		s, _ := claims[name].(string)
+		if !matchGlob(pattern, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func TestVerifyJWTSignatureRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const signed = "header.payload"
+	h := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := jwk{
+		Kid: "k1",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes()),
+	}
+
+	if err := verifyJWTSignature("RS256", "k1", signed, sig, []jwk{k}); err != nil {
+		t.Errorf("valid RS256 signature rejected: %v", err)
+	}
+
+	tampered := append([]byte{}, sig...)
+	tampered[0] ^= 0xff
+	if err := verifyJWTSignature("RS256", "k1", signed, tampered, []jwk{k}); err == nil {
+		t.Error("tampered RS256 signature verified")
+	}
+	if err := verifyJWTSignature("RS256", "k1", "different payload", sig, []jwk{k}); err == nil {
+		t.Error("signature over a different payload verified")
+	}
+}
+
+func TestVerifyJWTSignatureES256(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const signed = "header.payload"
+	h := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rBytes):32], rBytes)
+	copy(sig[64-len(sBytes):64], sBytes)
+
+	k := jwk{
+		Kid: "k2",
+		Alg: "ES256",
+		X:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.Y.Bytes()),
+	}
+
+	if err := verifyJWTSignature("ES256", "k2", signed, sig, []jwk{k}); err != nil {
+		t.Errorf("valid ES256 signature rejected: %v", err)
+	}
+
+	tampered := append([]byte{}, sig...)
+	tampered[0] ^= 0xff
+	if err := verifyJWTSignature("ES256", "k2", signed, tampered, []jwk{k}); err == nil {
+		t.Error("tampered ES256 signature verified")
+	}
+}
+
+func TestVerifyJWTSignatureNoMatchingKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const signed = "header.payload"
+	h := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := jwk{
+		Kid: "other-kid",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes()),
+	}
+
+	if err := verifyJWTSignature("RS256", "k1", signed, sig, []jwk{k}); err == nil {
+		t.Error("signature verified against a JWKS with no matching kid")
+	}
+}
@@ -0,0 +1,90 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"chain/errors"
+	"chain/net/http/authn"
+)
+
+const oidcDiscoveryCacheTTL = time.Hour
+
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type oidcCacheEntry struct {
+	doc     oidcDiscovery
+	fetched time.Time
+}
+
+var (
+	oidcCacheMu sync.Mutex
+	oidcCache   = make(map[string]oidcCacheEntry)
+)
+
+func fetchOIDCDiscovery(issuer string) (oidcDiscovery, error) {
+	oidcCacheMu.Lock()
+	entry, ok := oidcCache[issuer]
+	oidcCacheMu.Unlock()
+	if ok && time.Since(entry.fetched) < oidcDiscoveryCacheTTL {
+		return entry.doc, nil
+	}
+
+	resp, err := httpGuardClient.Get(strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return oidcDiscovery{}, errors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	var doc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return oidcDiscovery{}, errors.Wrap(err)
+	}
+
+	oidcCacheMu.Lock()
+	oidcCache[issuer] = oidcCacheEntry{doc: doc, fetched: time.Now()}
+	oidcCacheMu.Unlock()
+
+	return doc, nil
+}
+
+// matchesOIDC validates the bearer id_token against the discovery document
+// published by GuardData's issuer, reusing the same JWT verification as
+// the jwt guard, then checks the decoded claims against the configured
+// glob patterns. GuardData:
+//
+//	{"issuer": "https://accounts.example.com", "claims": {"aud": "my-app"}}
+func matchesOIDC(ctx context.Context, guardData []byte) (bool, error) {
+	var v struct {
+		Issuer string            `json:"issuer"`
+		Claims map[string]string `json:"claims"`
+	}
+	if err := json.Unmarshal(guardData, &v); err != nil {
+		return false, nil
+	}
+
+	token := authn.Token(ctx)
+	if token == "" {
+		return false, nil
+	}
+
+	doc, err := fetchOIDCDiscovery(v.Issuer)
+	if err != nil {
+		return false, nil // a slow or unreachable IdP doesn't match; it isn't a server error
+	}
+
+	claims, err := verifyJWT(token, doc.JWKSURI)
+	if err != nil {
+		return false, nil
+	}
+	if iss, _ := claims["iss"].(string); doc.Issuer != "" && iss != doc.Issuer {
+		return false, nil
+	}
+	return matchesClaims(claims, v.Claims), nil
+}
@@ -0,0 +1,30 @@
+package authz
+
+import "time"
+
+// ReadConsistency controls how an Authorizer reads grants from raft.
+type ReadConsistency int
+
+const (
+	// ReadStale serves grants from the local raft snapshot, optionally
+	// through an in-memory cache (see AuthorizerOptions.CacheTTL). This is
+	// fast but a recently-revoked grant may still authorize requests on a
+	// non-leader node until the snapshot or cache entry expires.
+	ReadStale ReadConsistency = iota
+	// ReadLinearizable always reads grants through the raft leader, so a
+	// revoked grant can never authorize a request once the revocation has
+	// committed, at the cost of a round trip to the leader on every
+	// Authorize call.
+	ReadLinearizable
+)
+
+// AuthorizerOptions configures how NewAuthorizerWithOptions reads grants
+// from raft. The zero value (ReadStale, no cache) matches the historical
+// behavior of NewAuthorizer.
+type AuthorizerOptions struct {
+	ReadConsistency ReadConsistency
+	// CacheTTL, if positive, caches unmarshaled GrantLists for this long
+	// under ReadStale so a busy route doesn't re-run proto.Unmarshal (or
+	// hit raft at all) on every request. Ignored under ReadLinearizable.
+	CacheTTL time.Duration
+}
@@ -0,0 +1,186 @@
+package authz
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"chain/errors"
+	"chain/net/http/authn"
+)
+
+// ErrRateLimited is returned by Authorize when an access_token_quota guard
+// matches the request's credential but its token bucket is empty. The
+// HTTP layer can translate this into a 429 response.
+var ErrRateLimited = errors.New("rate limited")
+
+// tokenBucket is a simple token-bucket rate limiter: it holds up to burst
+// tokens and refills at rps tokens per second.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rps      float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(rps, burst float64) *tokenBucket {
+	return &tokenBucket{rps: rps, burst: burst, tokens: burst, lastFill: time.Now()}
+}
+
+// setLimit updates an existing bucket's rate and burst, so a change to a
+// grant's quota config in raft takes effect for keys that already have a
+// bucket instead of only ones seen for the first time after the change.
+func (b *tokenBucket) setLimit(rps, burst float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rps = rps
+	b.burst = burst
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.lastFill).Seconds() * b.rps
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.lastFill = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// peek reports whether take would currently succeed, without draining a
+// token. It's used when tracing a decision (AuthorizeWithExplain) so
+// debugging a denial doesn't itself consume a rate-limited credential's
+// quota.
+func (b *tokenBucket) peek() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tokens := b.tokens + time.Since(b.lastFill).Seconds()*b.rps
+	if tokens > b.burst {
+		tokens = b.burst
+	}
+	return tokens >= 1
+}
+
+// defaultQuotaBucketCacheSize bounds how many distinct quota keys this
+// process tracks buckets for at once. A per_ip quota key fans out per
+// source address, so without a bound a single shared or leaked token hit
+// from many distinct IPs would grow the bucket set without limit.
+const defaultQuotaBucketCacheSize = 4096
+
+// quotaBuckets is an LRU-bounded set of process-local token buckets
+// backing the access_token_quota guard, keyed by token ID (optionally
+// suffixed with the remote IP). Bucket configuration (rps/burst) is
+// shared cluster-wide as a regular grant in raft, but the counters
+// themselves are local to each server, same as any other in-process rate
+// limiter; see grantListCache in cache.go for the same LRU shape.
+var quotaBuckets = newQuotaBucketCache(defaultQuotaBucketCacheSize)
+
+type quotaBucketEntry struct {
+	key    string
+	bucket *tokenBucket
+}
+
+type quotaBucketCache struct {
+	maxSize int
+
+	mu    sync.Mutex
+	ll    *list.List // front = most recently used
+	index map[string]*list.Element
+}
+
+func newQuotaBucketCache(maxSize int) *quotaBucketCache {
+	return &quotaBucketCache{
+		maxSize: maxSize,
+		ll:      list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+// get returns the bucket for key, creating it with rps/burst if it
+// doesn't exist yet, and otherwise refreshing its limit to rps/burst in
+// case the grant's quota config has since changed.
+func (c *quotaBucketCache) get(key string, rps, burst float64) *tokenBucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.index[key]; ok {
+		c.ll.MoveToFront(el)
+		b := el.Value.(*quotaBucketEntry).bucket
+		b.setLimit(rps, burst)
+		return b
+	}
+
+	b := newTokenBucket(rps, burst)
+	el := c.ll.PushFront(&quotaBucketEntry{key: key, bucket: b})
+	c.index[key] = el
+
+	for c.ll.Len() > c.maxSize {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.index, oldest.Value.(*quotaBucketEntry).key)
+	}
+
+	return b
+}
+
+func quotaBucketFor(key string, rps, burst float64) *tokenBucket {
+	return quotaBuckets.get(key, rps, burst)
+}
+
+// matchesAccessTokenQuota matches like the access_token guard, but on a
+// match also drains a token bucket keyed by the token ID (optionally
+// split per remote IP) before allowing the request through. GuardData:
+//
+//	{"id": "my-token", "rps": 5, "burst": 10, "per_ip": true}
+//
+// Under AuthorizeWithExplain (ctx marked by withTraceOnly), the bucket is
+// only peeked at, never drained, so a debugging call can't push a
+// legitimate caller into ErrRateLimited.
+func matchesAccessTokenQuota(ctx context.Context, guardData []byte) (bool, error) {
+	var v struct {
+		ID    string  `json:"id"`
+		RPS   float64 `json:"rps"`
+		Burst float64 `json:"burst"`
+		PerIP bool    `json:"per_ip"`
+	}
+	if err := json.Unmarshal(guardData, &v); err != nil {
+		return false, nil
+	}
+	if v.ID == "" || v.ID != authn.Token(ctx) {
+		return false, nil
+	}
+
+	key := v.ID
+	if v.PerIP {
+		if ip := authn.RemoteIP(ctx); ip != nil {
+			key += "/" + ip.String()
+		}
+	}
+
+	bucket := quotaBucketFor(key, v.RPS, v.Burst)
+	var ok bool
+	if isTraceOnly(ctx) {
+		ok = bucket.peek()
+	} else {
+		ok = bucket.take()
+	}
+	if !ok {
+		return false, abortEvaluation(ErrRateLimited)
+	}
+	return true, nil
+}
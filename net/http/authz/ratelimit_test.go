@@ -0,0 +1,76 @@
+package authz
+
+import "testing"
+
+func TestTokenBucketTakeDrainsBurst(t *testing.T) {
+	b := newTokenBucket(0, 2) // rps=0: no refill within the test, burst=2
+	if !b.take() {
+		t.Fatal("first take of a fresh burst-2 bucket should succeed")
+	}
+	if !b.take() {
+		t.Fatal("second take of a fresh burst-2 bucket should succeed")
+	}
+	if b.take() {
+		t.Fatal("third take should fail once the bucket is drained")
+	}
+}
+
+func TestTokenBucketPeekDoesNotDrain(t *testing.T) {
+	b := newTokenBucket(0, 1)
+	if !b.peek() {
+		t.Fatal("peek on a full bucket should report tokens available")
+	}
+	if !b.peek() {
+		t.Fatal("peek must not drain the bucket, so a second peek should also succeed")
+	}
+	if !b.take() {
+		t.Fatal("take after only peeking should still succeed")
+	}
+	if b.take() {
+		t.Fatal("bucket should be empty after the one real take")
+	}
+}
+
+func TestTokenBucketSetLimitClampsTokensToNewBurst(t *testing.T) {
+	b := newTokenBucket(0, 10)
+	b.setLimit(0, 1)
+	if !b.take() {
+		t.Fatal("first take after shrinking burst to 1 should succeed")
+	}
+	if b.take() {
+		t.Fatal("tokens should have been clamped to the new, smaller burst")
+	}
+}
+
+func TestQuotaBucketCacheReusesAndUpdatesLimit(t *testing.T) {
+	c := newQuotaBucketCache(10)
+
+	b1 := c.get("key", 0, 5)
+	b2 := c.get("key", 0, 1)
+	if b1 != b2 {
+		t.Fatal("a second get for the same key should return the same bucket, not a new one")
+	}
+	if b2.burst != 1 {
+		t.Fatalf("burst = %v, want the refreshed limit of 1", b2.burst)
+	}
+}
+
+func TestQuotaBucketCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newQuotaBucketCache(2)
+
+	first := c.get("a", 0, 1)
+	c.get("b", 0, 1)
+	c.get("c", 0, 1) // over capacity: evicts "a", the least recently used
+
+	if _, ok := c.index["a"]; ok {
+		t.Fatal("oldest key should have been evicted once the cache exceeded its max size")
+	}
+	if c.ll.Len() != 2 {
+		t.Fatalf("cache len = %d, want 2", c.ll.Len())
+	}
+
+	again := c.get("a", 0, 1)
+	if again == first {
+		t.Fatal("after eviction, getting the old key should create a fresh bucket")
+	}
+}
@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"chain/crypto/x509/name"
+)
+
+// x509Pattern is the parsed form of an x509 grant's GuardData. Grants
+// written before this JSON schema existed store the legacy name.Format
+// output instead; parseX509GuardData sniffs which one it's looking at.
+type x509Pattern struct {
+	legacy *pkix.Name
+
+	CommonName         string   `json:"common_name"`
+	Organization       []string `json:"organization"`
+	OrganizationalUnit []string `json:"organizational_unit"`
+
+	// Permitted/excluded lists apply RFC 5280 4.2.1.10 style name
+	// constraints to the peer certificate's SANs: a SAN must avoid every
+	// excluded entry, and, if any permitted entries are given, match at
+	// least one of them.
+	PermittedDNS    []string `json:"permitted_dns"`
+	ExcludedDNS     []string `json:"excluded_dns"`
+	PermittedURIs   []string `json:"permitted_uris"`
+	ExcludedURIs    []string `json:"excluded_uris"`
+	PermittedEmails []string `json:"permitted_emails"`
+	ExcludedEmails  []string `json:"excluded_emails"`
+}
+
+func parseX509GuardData(data []byte) (*x509Pattern, error) {
+	if looksLikeJSONObject(data) {
+		var p x509Pattern
+		if err := json.Unmarshal(data, &p); err == nil {
+			return &p, nil
+		}
+	}
+
+	legacy, err := name.Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &x509Pattern{legacy: &legacy}, nil
+}
+
+func looksLikeJSONObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// matches reports whether cert satisfies p: its Subject RDNs (CommonName
+// and OrganizationalUnit glob-matched, Organization matched exactly) and,
+// if configured, its SAN DNS names, URIs and email addresses against the
+// name constraints.
+func (p *x509Pattern) matches(cert *x509.Certificate) bool {
+	if p.legacy != nil {
+		return matchesX509(*p.legacy, cert.Subject)
+	}
+
+	if !matchGlob(p.CommonName, cert.Subject.CommonName) {
+		return false
+	}
+	if !matchesStrings(p.Organization, cert.Subject.Organization) {
+		return false
+	}
+	if !matchesGlobStrings(p.OrganizationalUnit, cert.Subject.OrganizationalUnit) {
+		return false
+	}
+
+	if len(p.PermittedDNS) > 0 || len(p.ExcludedDNS) > 0 {
+		if !matchesNameConstraints(p.PermittedDNS, p.ExcludedDNS, cert.DNSNames, matchesDomainConstraint) {
+			return false
+		}
+	}
+	if len(p.PermittedURIs) > 0 || len(p.ExcludedURIs) > 0 {
+		uris := make([]string, len(cert.URIs))
+		for i, u := range cert.URIs {
+			uris[i] = u.String()
+		}
+		if !matchesNameConstraints(p.PermittedURIs, p.ExcludedURIs, uris, matchesURIConstraint) {
+			return false
+		}
+	}
+	if len(p.PermittedEmails) > 0 || len(p.ExcludedEmails) > 0 {
+		if !matchesNameConstraints(p.PermittedEmails, p.ExcludedEmails, cert.EmailAddresses, matchesEmailConstraint) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesGlobStrings is matchesStrings with '*'-wildcard elements.
+func matchesGlobStrings(pat, x []string) bool {
+	if len(x) < len(pat) {
+		return false
+	}
+	for i, p := range pat {
+		if !matchGlob(p, x[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesNameConstraints reports whether every name in names avoids all
+// excluded constraints and, when permitted is non-empty, matches at least
+// one of them. match tests a single (constraint, name) pair.
+//
+// A permitted list scopes access to certs that actually present a SAN of
+// that kind: a cert with no names at all does not vacuously satisfy a
+// non-empty permitted list.
+func matchesNameConstraints(permitted, excluded, names []string, match func(constraint, name string) bool) bool {
+	if len(permitted) > 0 && len(names) == 0 {
+		return false
+	}
+	for _, n := range names {
+		for _, c := range excluded {
+			if match(c, n) {
+				return false
+			}
+		}
+		if len(permitted) == 0 {
+			continue
+		}
+		allowed := false
+		for _, c := range permitted {
+			if match(c, n) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesDomainConstraint implements RFC 5280 4.2.1.10 dNSName matching:
+// constraint matches name if name equals constraint or is a subdomain of it.
+func matchesDomainConstraint(constraint, domain string) bool {
+	constraint = strings.TrimPrefix(strings.ToLower(constraint), ".")
+	domain = strings.ToLower(domain)
+	return constraint == domain || strings.HasSuffix(domain, "."+constraint)
+}
+
+func matchesEmailConstraint(constraint, email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(constraint, email)
+	}
+	return matchesDomainConstraint(constraint, email[at+1:])
+}
+
+func matchesURIConstraint(constraint, rawURI string) bool {
+	u, err := url.Parse(rawURI)
+	if err != nil {
+		return false
+	}
+	return matchesDomainConstraint(constraint, u.Hostname())
+}
@@ -0,0 +1,84 @@
+package authz
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestMatchesNameConstraints(t *testing.T) {
+	exact := func(constraint, name string) bool { return constraint == name }
+
+	cases := []struct {
+		name               string
+		permitted, exclude []string
+		names              []string
+		want               bool
+	}{
+		{"no constraints configured", nil, nil, []string{"a"}, true},
+		{
+			name:      "permitted set but cert has no names at all",
+			permitted: []string{"example.com"},
+			names:     nil,
+			want:      false, // regression test for the bypass a0b420e fixed
+		},
+		{
+			name:      "permitted set and a name matches",
+			permitted: []string{"example.com"},
+			names:     []string{"example.com"},
+			want:      true,
+		},
+		{
+			name:      "permitted set but no name matches",
+			permitted: []string{"example.com"},
+			names:     []string{"other.com"},
+			want:      false,
+		},
+		{
+			name:      "excluded name always fails regardless of permitted",
+			permitted: []string{"blocked.com"},
+			exclude:   []string{"blocked.com"},
+			names:     []string{"blocked.com"},
+			want:      false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := matchesNameConstraints(c.permitted, c.exclude, c.names, exact); got != c.want {
+				t.Errorf("matchesNameConstraints(%v, %v, %v) = %v, want %v", c.permitted, c.exclude, c.names, got, c.want)
+			}
+		})
+	}
+}
+
+func TestX509PatternMatchesRequiresPermittedSAN(t *testing.T) {
+	p := &x509Pattern{PermittedDNS: []string{"example.com"}}
+
+	withSAN := &x509.Certificate{DNSNames: []string{"api.example.com"}}
+	if !p.matches(withSAN) {
+		t.Error("cert with a DNS SAN matching the permitted domain should match")
+	}
+
+	withoutSAN := &x509.Certificate{Subject: pkix.Name{CommonName: ""}}
+	if p.matches(withoutSAN) {
+		t.Error("cert with no DNS SANs at all should not satisfy a non-empty permitted_dns list")
+	}
+
+	wrongDomain := &x509.Certificate{DNSNames: []string{"evil.com"}}
+	if p.matches(wrongDomain) {
+		t.Error("cert with a DNS SAN outside the permitted domain should not match")
+	}
+}
+
+func TestParseX509GuardDataJSON(t *testing.T) {
+	p, err := parseX509GuardData([]byte(`{"common_name":"svc-*","permitted_dns":["example.com"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.legacy != nil {
+		t.Fatal("JSON guard data should not be parsed as the legacy name.Format schema")
+	}
+	if p.CommonName != "svc-*" || len(p.PermittedDNS) != 1 || p.PermittedDNS[0] != "example.com" {
+		t.Fatalf("parsed pattern = %+v, want common_name svc-* and permitted_dns [example.com]", p)
+	}
+}